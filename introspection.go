@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tonit/actions-oidc-gateway/jwks"
+)
+
+// defaultIntrospectionCacheTTL bounds how long an introspection result is
+// cached when the provider's response has no exp field to key off of.
+const defaultIntrospectionCacheTTL = time.Minute
+
+type cachedIntrospection struct {
+	claims map[string]interface{}
+	exp    time.Time
+}
+
+// OpaqueTokenValidator validates opaque bearer tokens via RFC 7662 token
+// introspection, for identity providers that don't issue JWTs. Successful
+// introspections are cached (keyed by token hash) until the token's exp,
+// or for defaultIntrospectionCacheTTL if the provider didn't return one,
+// so repeated proxy requests don't hammer the IdP.
+type OpaqueTokenValidator struct {
+	IntrospectionEndpoint string
+	ClientID              string
+	ClientSecret          string
+
+	cache sync.Map // sha256 hex digest -> cachedIntrospection
+}
+
+// NewOpaqueTokenValidator constructs a validator that introspects tokens
+// against introspectionEndpoint using HTTP Basic client authentication.
+func NewOpaqueTokenValidator(introspectionEndpoint, clientID, clientSecret string) *OpaqueTokenValidator {
+	return &OpaqueTokenValidator{
+		IntrospectionEndpoint: introspectionEndpoint,
+		ClientID:              clientID,
+		ClientSecret:          clientSecret,
+	}
+}
+
+// DiscoverIntrospectionEndpoint looks up the introspection_endpoint
+// advertised in discoveryURL's "/.well-known/openid-configuration" document,
+// so the gateway can be pointed at an issuer rather than a raw introspection
+// URL (same idea as jwks.Manager discovering jwks_uri).
+func DiscoverIntrospectionEndpoint(discoveryURL string) (string, error) {
+	metadata, err := jwks.DiscoverMetadata(discoveryURL)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, ok := metadata["introspection_endpoint"].(string)
+	if !ok {
+		return "", fmt.Errorf("OpenID configuration is missing introspection_endpoint")
+	}
+
+	return endpoint, nil
+}
+
+// Validate introspects token and returns its claims if the provider reports
+// it active. The returned map is treated just like JWT claims by the
+// policy engine downstream.
+func (v *OpaqueTokenValidator) Validate(token string) (map[string]interface{}, error) {
+	tokenHash := jwks.HashToken(token)
+	if claims, ok := v.cachedClaims(tokenHash); ok {
+		return claims, nil
+	}
+
+	form := url.Values{}
+	form.Set("token", token)
+
+	req, err := http.NewRequest(http.MethodPost, v.IntrospectionEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to build introspection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(v.ClientID, v.ClientSecret)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach introspection endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read introspection response: %w", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return nil, fmt.Errorf("unable to parse introspection response: %w", err)
+	}
+
+	active, ok := claims["active"].(bool)
+	if !ok || !active {
+		return nil, fmt.Errorf("token is not active")
+	}
+
+	exp := time.Now().Add(defaultIntrospectionCacheTTL)
+	if expClaim, ok := claims["exp"].(float64); ok {
+		exp = time.Unix(int64(expClaim), 0)
+	}
+	v.cache.Store(tokenHash, cachedIntrospection{claims: claims, exp: exp})
+
+	return claims, nil
+}
+
+func (v *OpaqueTokenValidator) cachedClaims(tokenHash string) (map[string]interface{}, bool) {
+	c, ok := v.cache.Load(tokenHash)
+	if !ok {
+		return nil, false
+	}
+	entry := c.(cachedIntrospection)
+	if time.Now().After(entry.exp) {
+		v.cache.Delete(tokenHash)
+		return nil, false
+	}
+	return entry.claims, true
+}
+
+// looksLikeJWT reports whether token has the three dot-separated segments
+// of a JWT. Opaque tokens from providers like Sigstore's Fulcio CA or
+// classic OAuth2 servers don't.
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
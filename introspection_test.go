@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOpaqueTokenValidator_Validate_Active(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": "workflow"})
+	}))
+	defer server.Close()
+
+	v := NewOpaqueTokenValidator(server.URL, "client", "secret")
+
+	claims, err := v.Validate("opaque-token-1")
+	if err != nil {
+		t.Fatalf("expected an active token to validate: %v", err)
+	}
+	if claims["sub"] != "workflow" {
+		t.Fatalf("expected claims to be passed through, got %v", claims)
+	}
+
+	if _, err := v.Validate("opaque-token-1"); err != nil {
+		t.Fatalf("expected the cached validation to succeed without another request: %v", err)
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected caching to avoid a second introspection request, got %d requests", got)
+	}
+}
+
+func TestOpaqueTokenValidator_Validate_Inactive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+	}))
+	defer server.Close()
+
+	v := NewOpaqueTokenValidator(server.URL, "client", "secret")
+	if _, err := v.Validate("opaque-token-2"); err == nil {
+		t.Fatal("expected an inactive token to be rejected")
+	}
+}
+
+func TestOpaqueTokenValidator_Validate_MissingActiveField(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"sub": "workflow"})
+	}))
+	defer server.Close()
+
+	v := NewOpaqueTokenValidator(server.URL, "client", "secret")
+	if _, err := v.Validate("opaque-token-3"); err == nil {
+		t.Fatal("expected a response with no active field to be rejected")
+	}
+}
+
+func TestOpaqueTokenValidator_Validate_MalformedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	v := NewOpaqueTokenValidator(server.URL, "client", "secret")
+	if _, err := v.Validate("opaque-token-4"); err == nil {
+		t.Fatal("expected a malformed introspection response to error")
+	}
+}
+
+func TestOpaqueTokenValidator_Validate_UnreachableEndpoint(t *testing.T) {
+	v := NewOpaqueTokenValidator("http://127.0.0.1:0", "client", "secret")
+	if _, err := v.Validate("opaque-token-5"); err == nil {
+		t.Fatal("expected an unreachable introspection endpoint to error")
+	}
+}
+
+func TestDiscoverIntrospectionEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"introspection_endpoint": "https://idp.example/introspect"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	endpoint, err := DiscoverIntrospectionEndpoint(server.URL)
+	if err != nil {
+		t.Fatalf("unable to discover introspection endpoint: %v", err)
+	}
+	if endpoint != "https://idp.example/introspect" {
+		t.Fatalf("got %q", endpoint)
+	}
+}
+
+func TestDiscoverIntrospectionEndpoint_MissingField(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": "https://idp.example/jwks"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if _, err := DiscoverIntrospectionEndpoint(server.URL); err == nil {
+		t.Fatal("expected a discovery document with no introspection_endpoint to error")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tonit/actions-oidc-gateway/jwks"
+)
+
+// IssuersConfig is the top-level shape of the trusted issuers file.
+type IssuersConfig struct {
+	Issuers []jwks.Issuer `yaml:"issuers"`
+}
+
+// LoadIssuers reads the list of trusted OIDC issuers from a YAML file, so
+// adding GitLab, a self-hosted provider, Sigstore's Fulcio, or any other
+// OIDC-compliant issuer is a config change rather than a recompile.
+func LoadIssuers(issuersPath string) ([]jwks.Issuer, error) {
+	data, err := os.ReadFile(issuersPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read issuers file: %w", err)
+	}
+
+	var config IssuersConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse issuers file: %w", err)
+	}
+
+	if len(config.Issuers) == 0 {
+		return nil, fmt.Errorf("issuers file %q defines no trusted issuers", issuersPath)
+	}
+
+	return config.Issuers, nil
+}
@@ -0,0 +1,299 @@
+// Package jwks fetches and caches a JSON Web Key Set from an OIDC
+// discovery endpoint, and caches the outcome of validating tokens against
+// it so repeated requests from the same workflow don't re-parse and
+// re-verify the same JWT.
+package jwks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// JWK is a single JSON Web Key as returned by a provider's JWKS endpoint.
+// N/E describe an RSA key; Crv/X/Y describe an EC key (kty "EC"); Crv/X
+// describe an OKP key (kty "OKP", e.g. Ed25519).
+type JWK struct {
+	Kty string
+	Kid string
+	Alg string
+	Use string
+	X5c []string
+	X5t string
+
+	N string
+	E string
+
+	Crv string
+	X   string
+	Y   string
+}
+
+// JWKS is the document served from a provider's jwks_uri.
+type JWKS struct {
+	Keys []JWK
+}
+
+// Manager fetches a JWKS from DiscoveryURL and refreshes it in the
+// background on RefreshInterval. One Manager tracks exactly one issuer;
+// see Registry for selecting among several trusted issuers.
+type Manager struct {
+	DiscoveryURL    string
+	RefreshInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      JWKS
+	expiresAt time.Time // when the cached JWKS itself should be refetched
+
+	group             singleflight.Group // coalesces concurrent refreshes into one fetch
+	lastForcedRefresh time.Time          // rate-limits the unknown-kid forced refetch below
+}
+
+// minForcedRefreshInterval bounds how often an unknown kid can force a
+// synchronous refetch in Key, independent of the cached JWKS's own TTL. Key
+// is reachable pre-auth (jwt.Parse calls it before verifying the signature),
+// so without this a caller could force a refetch of the real IdP's discovery
+// document and JWKS on every request just by varying the kid.
+//
+// A var rather than a const so tests can shrink it instead of sleeping for
+// the real interval.
+var minForcedRefreshInterval = 5 * time.Second
+
+// NewManager constructs a Manager for the given OIDC discovery URL
+// (e.g. "https://token.actions.githubusercontent.com"). Call Start to
+// begin background refreshes before serving traffic.
+func NewManager(discoveryURL string, refreshInterval time.Duration) *Manager {
+	return &Manager{
+		DiscoveryURL:    discoveryURL,
+		RefreshInterval: refreshInterval,
+	}
+}
+
+// Start fetches the JWKS once synchronously, then refreshes it in the
+// background every RefreshInterval until ctx is cancelled.
+func (m *Manager) Start(ctx context.Context) error {
+	if err := m.refreshCoalesced(); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.RefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.refreshCoalesced(); err != nil {
+					fmt.Println("jwks: background refresh failed: " + err.Error())
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// refreshCoalesced calls refresh, folding concurrent callers into a single
+// in-flight fetch via singleflight rather than each firing its own HTTP
+// requests against the discovery document and JWKS endpoint.
+func (m *Manager) refreshCoalesced() error {
+	_, err, _ := m.group.Do("refresh", func() (interface{}, error) {
+		return nil, m.refresh()
+	})
+	return err
+}
+
+// DiscoverMetadata fetches and parses the
+// "/.well-known/openid-configuration" document for discoveryURL, the
+// shared provider metadata document both JWKS discovery and introspection
+// endpoint discovery read from.
+func DiscoverMetadata(discoveryURL string) (map[string]interface{}, error) {
+	resp, err := http.Get(discoveryURL + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get OpenID configuration: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get OpenID configuration (parsing body): %w", err)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unable to parse OpenID configuration: %w", err)
+	}
+
+	return result, nil
+}
+
+func (m *Manager) discoverJwksURL() (string, error) {
+	metadata, err := DiscoverMetadata(m.DiscoveryURL)
+	if err != nil {
+		return "", err
+	}
+
+	jwksURI, ok := metadata["jwks_uri"].(string)
+	if !ok {
+		return "", fmt.Errorf("OpenID configuration is missing jwks_uri")
+	}
+
+	return jwksURI, nil
+}
+
+// refresh re-fetches the JWKS unconditionally, honoring Cache-Control
+// max-age and Expires response headers to decide when the cached keys go
+// stale (after which Key refetches on demand). The background refresh in
+// Start still runs every RefreshInterval regardless of those headers.
+func (m *Manager) refresh() error {
+	jwksURL, err := m.discoverJwksURL()
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Get(jwksURL)
+	if err != nil {
+		return fmt.Errorf("unable to get JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read JWKS body: %w", err)
+	}
+
+	var keys JWKS
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return fmt.Errorf("unable to parse JWKS: %w", err)
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.expiresAt = time.Now().Add(m.RefreshInterval)
+	if expiresAt, ok := cacheExpiry(resp.Header); ok {
+		m.expiresAt = expiresAt
+	}
+	m.mu.Unlock()
+
+	if OnRefresh != nil {
+		OnRefresh()
+	}
+
+	return nil
+}
+
+// OnRefresh, if set, is called after every successful JWKS refresh across
+// all Managers. The gateway uses this to drive the
+// gateway_jwks_refresh_total metric without this package depending on
+// Prometheus directly.
+var OnRefresh func()
+
+// cacheExpiry derives a refresh deadline from the Cache-Control max-age or
+// Expires response headers, in that order of preference.
+func cacheExpiry(header http.Header) (time.Time, bool) {
+	if maxAge, ok := cacheControlMaxAge(header.Get("Cache-Control")); ok {
+		return time.Now().Add(time.Duration(maxAge) * time.Second), true
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// cacheControlMaxAge extracts max-age from a Cache-Control header that may
+// carry several comma-separated directives (e.g. "public, max-age=86400"
+// or "max-age=86400, must-revalidate"), not just a bare "max-age=N".
+func cacheControlMaxAge(cacheControl string) (int, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		value, ok := strings.CutPrefix(directive, "max-age=")
+		if !ok {
+			continue
+		}
+		maxAge, err := strconv.Atoi(value)
+		if err != nil || maxAge <= 0 {
+			continue
+		}
+		return maxAge, true
+	}
+	return 0, false
+}
+
+func (m *Manager) keyForKid(kid string) (*JWK, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, key := range m.keys.Keys {
+		if key.Kid == kid {
+			return &key, true
+		}
+	}
+	return nil, false
+}
+
+func (m *Manager) needsRefresh() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.keys.Keys) == 0 || time.Now().After(m.expiresAt)
+}
+
+// Key looks up the JWK for kid, refreshing the cached JWKS first if it's
+// gone stale. If kid still isn't found -- which can happen immediately
+// after the provider rotates its signing keys -- it forces one more
+// synchronous refetch before giving up, rather than waiting for the next
+// scheduled refresh.
+//
+// Key is reachable pre-auth (jwt.Parse calls the Keyfunc before verifying
+// the token's signature), so both refresh paths are coalesced via
+// singleflight, and the unknown-kid forced refetch is additionally
+// rate-limited by minForcedRefreshInterval -- otherwise a caller could force
+// a synchronous discovery+JWKS fetch against the real IdP on every request
+// just by sending a bogus kid.
+func (m *Manager) Key(kid string) (*JWK, error) {
+	if m.needsRefresh() {
+		if err := m.refreshCoalesced(); err != nil {
+			return nil, fmt.Errorf("unable to refresh JWKS: %w", err)
+		}
+	}
+
+	jwk, ok := m.keyForKid(kid)
+	if !ok {
+		if !m.allowForcedRefresh() {
+			return nil, fmt.Errorf("unknown kid: %v", kid)
+		}
+		// Unknown kid: force an immediate refetch in case the key was
+		// rotated in between our last scheduled refresh and now.
+		if err := m.refreshCoalesced(); err != nil {
+			return nil, fmt.Errorf("unable to refresh JWKS: %w", err)
+		}
+		jwk, ok = m.keyForKid(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown kid: %v", kid)
+		}
+	}
+
+	return jwk, nil
+}
+
+// allowForcedRefresh reports whether enough time has passed since the last
+// unknown-kid forced refresh to allow another one, and if so records this
+// attempt as the new last one.
+func (m *Manager) allowForcedRefresh() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if time.Since(m.lastForcedRefresh) < minForcedRefreshInterval {
+		return false
+	}
+	m.lastForcedRefresh = time.Now()
+	return true
+}
@@ -0,0 +1,170 @@
+package jwks
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestProvider serves a minimal OIDC discovery document and JWKS, and
+// reports how many times the jwks_uri was fetched.
+func newTestProvider(t *testing.T, keys JWKS) (server *httptest.Server, jwksHits *int32) {
+	t.Helper()
+	jwksHits = new(int32)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": "http://" + r.Host + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(jwksHits, 1)
+		json.NewEncoder(w).Encode(keys)
+	})
+
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, jwksHits
+}
+
+func TestManager_Key_ForcedRefresh_Coalesces(t *testing.T) {
+	server, jwksHits := newTestProvider(t, JWKS{Keys: []JWK{{Kty: "RSA", Kid: "known", N: "n", E: "AQAB"}}})
+
+	m := NewManager(server.URL, time.Hour)
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("unable to start manager: %v", err)
+	}
+	atomic.StoreInt32(jwksHits, 0) // ignore the initial Start() fetch
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Key("unknown-kid")
+		}()
+	}
+	wg.Wait()
+
+	if hits := atomic.LoadInt32(jwksHits); hits > 1 {
+		t.Fatalf("expected 20 concurrent unknown-kid lookups to coalesce into at most one refresh, got %d", hits)
+	}
+}
+
+func TestManager_Key_ForcedRefresh_RateLimited(t *testing.T) {
+	original := minForcedRefreshInterval
+	minForcedRefreshInterval = 50 * time.Millisecond
+	defer func() { minForcedRefreshInterval = original }()
+
+	server, jwksHits := newTestProvider(t, JWKS{Keys: []JWK{{Kty: "RSA", Kid: "known", N: "n", E: "AQAB"}}})
+
+	m := NewManager(server.URL, time.Hour)
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("unable to start manager: %v", err)
+	}
+	atomic.StoreInt32(jwksHits, 0)
+
+	if _, err := m.Key("unknown-kid"); err == nil {
+		t.Fatal("expected an unknown kid to error")
+	}
+	if hits := atomic.LoadInt32(jwksHits); hits != 1 {
+		t.Fatalf("expected the first unknown-kid lookup to force exactly one refresh, got %d", hits)
+	}
+
+	if _, err := m.Key("unknown-kid"); err == nil {
+		t.Fatal("expected an unknown kid to error")
+	}
+	if hits := atomic.LoadInt32(jwksHits); hits != 1 {
+		t.Fatalf("expected a lookup within minForcedRefreshInterval not to force another refresh, got %d", hits)
+	}
+
+	time.Sleep(75 * time.Millisecond)
+
+	if _, err := m.Key("unknown-kid"); err == nil {
+		t.Fatal("expected an unknown kid to error")
+	}
+	if hits := atomic.LoadInt32(jwksHits); hits != 2 {
+		t.Fatalf("expected a lookup after minForcedRefreshInterval to force another refresh, got %d", hits)
+	}
+}
+
+func TestManager_Key_FindsKeyAfterRotation(t *testing.T) {
+	var rotated int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": "http://" + r.Host + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		keys := JWKS{Keys: []JWK{{Kty: "RSA", Kid: "old-kid", N: "n", E: "AQAB"}}}
+		if atomic.LoadInt32(&rotated) == 1 {
+			keys = JWKS{Keys: []JWK{{Kty: "RSA", Kid: "new-kid", N: "n", E: "AQAB"}}}
+		}
+		json.NewEncoder(w).Encode(keys)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	m := NewManager(server.URL, time.Hour)
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("unable to start manager: %v", err)
+	}
+
+	// The provider rotates its keys after the initial fetch, so new-kid is
+	// only reachable through the unknown-kid forced refresh.
+	atomic.StoreInt32(&rotated, 1)
+
+	jwk, err := m.Key("new-kid")
+	if err != nil {
+		t.Fatalf("expected the forced refresh to find the rotated key: %v", err)
+	}
+	if jwk.Kid != "new-kid" {
+		t.Fatalf("got kid %q", jwk.Kid)
+	}
+}
+
+func TestCacheControlMaxAge_MultiDirective(t *testing.T) {
+	cases := []struct {
+		header string
+		want   int
+		wantOk bool
+	}{
+		{"public, max-age=86400", 86400, true},
+		{"max-age=86400, must-revalidate", 86400, true},
+		{"max-age=86400", 86400, true},
+		{"no-store", 0, false},
+		{"max-age=0", 0, false},
+		{"max-age=not-a-number", 0, false},
+		{"", 0, false},
+	}
+
+	for _, c := range cases {
+		got, ok := cacheControlMaxAge(c.header)
+		if ok != c.wantOk || got != c.want {
+			t.Errorf("cacheControlMaxAge(%q) = (%d, %v), want (%d, %v)", c.header, got, ok, c.want, c.wantOk)
+		}
+	}
+}
+
+func TestCacheExpiry_FallsBackToExpiresHeader(t *testing.T) {
+	header := http.Header{}
+	expires := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+	header.Set("Expires", expires.Format(http.TimeFormat))
+
+	got, ok := cacheExpiry(header)
+	if !ok {
+		t.Fatal("expected an Expires header to be honored when Cache-Control is absent")
+	}
+	if !got.Equal(expires) {
+		t.Fatalf("got %v, want %v", got, expires)
+	}
+}
+
+func TestCacheExpiry_NoHeaders(t *testing.T) {
+	if _, ok := cacheExpiry(http.Header{}); ok {
+		t.Fatal("expected no cache hint when neither header is set")
+	}
+}
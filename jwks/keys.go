@@ -0,0 +1,88 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// PublicKey builds the crypto public key a jwt.Keyfunc should return for
+// jwk, based on its kty. RSA keys (kty "RSA") back RS256; EC keys (kty
+// "EC") back ES256/ES384; OKP keys (kty "OKP", crv "Ed25519") back EdDSA.
+func PublicKey(jwk *JWK) (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		return rsaPublicKey(jwk)
+	case "EC":
+		return ecPublicKey(jwk)
+	case "OKP":
+		return okpPublicKey(jwk)
+	default:
+		return nil, fmt.Errorf("unsupported key type: %q", jwk.Kty)
+	}
+}
+
+func rsaPublicKey(jwk *JWK) (interface{}, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse key modulus")
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse key exponent")
+	}
+
+	var n, e big.Int
+	return &rsa.PublicKey{
+		N: n.SetBytes(nBytes),
+		E: int(e.SetBytes(eBytes).Uint64()),
+	}, nil
+}
+
+func ecPublicKey(jwk *JWK) (interface{}, error) {
+	var curve elliptic.Curve
+	switch jwk.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	default:
+		return nil, fmt.Errorf("unsupported EC curve: %q", jwk.Crv)
+	}
+
+	xBytes, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse key x coordinate")
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse key y coordinate")
+	}
+
+	var x, y big.Int
+	return &ecdsa.PublicKey{
+		Curve: curve,
+		X:     x.SetBytes(xBytes),
+		Y:     y.SetBytes(yBytes),
+	}, nil
+}
+
+func okpPublicKey(jwk *JWK) (interface{}, error) {
+	if jwk.Crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported OKP curve: %q", jwk.Crv)
+	}
+
+	xBytes, err := base64.RawURLEncoding.DecodeString(jwk.X)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse key x coordinate")
+	}
+	if len(xBytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 public key length: %d", len(xBytes))
+	}
+
+	return ed25519.PublicKey(xBytes), nil
+}
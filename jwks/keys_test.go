@@ -0,0 +1,171 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestPublicKey_RSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate RSA key: %v", err)
+	}
+
+	jwk := &JWK{
+		Kty: "RSA",
+		N:   b64(priv.N.Bytes()),
+		E:   b64(big.NewInt(int64(priv.E)).Bytes()),
+	}
+
+	key, err := PublicKey(jwk)
+	if err != nil {
+		t.Fatalf("unable to build RSA public key: %v", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		t.Fatalf("expected *rsa.PublicKey, got %T", key)
+	}
+	if rsaKey.N.Cmp(priv.N) != 0 || rsaKey.E != priv.E {
+		t.Fatal("parsed RSA key does not match the generated key")
+	}
+}
+
+func TestPublicKey_RSA_BadModulus(t *testing.T) {
+	jwk := &JWK{Kty: "RSA", N: "not-base64!!!", E: b64(big.NewInt(65537).Bytes())}
+
+	if _, err := PublicKey(jwk); err == nil {
+		t.Fatal("expected malformed RSA modulus to be rejected")
+	}
+}
+
+func TestPublicKey_EC_P256(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate EC key: %v", err)
+	}
+
+	jwk := &JWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   b64(priv.X.Bytes()),
+		Y:   b64(priv.Y.Bytes()),
+	}
+
+	key, err := PublicKey(jwk)
+	if err != nil {
+		t.Fatalf("unable to build EC public key: %v", err)
+	}
+
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatalf("expected *ecdsa.PublicKey, got %T", key)
+	}
+	if ecKey.X.Cmp(priv.X) != 0 || ecKey.Y.Cmp(priv.Y) != 0 {
+		t.Fatal("parsed EC key does not match the generated key")
+	}
+	if ecKey.Curve != elliptic.P256() {
+		t.Fatal("expected P-256 curve")
+	}
+}
+
+func TestPublicKey_EC_P384(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate EC key: %v", err)
+	}
+
+	jwk := &JWK{
+		Kty: "EC",
+		Crv: "P-384",
+		X:   b64(priv.X.Bytes()),
+		Y:   b64(priv.Y.Bytes()),
+	}
+
+	key, err := PublicKey(jwk)
+	if err != nil {
+		t.Fatalf("unable to build EC public key: %v", err)
+	}
+	if key.(*ecdsa.PublicKey).Curve != elliptic.P384() {
+		t.Fatal("expected P-384 curve")
+	}
+}
+
+func TestPublicKey_EC_UnsupportedCurve(t *testing.T) {
+	jwk := &JWK{Kty: "EC", Crv: "P-521", X: b64([]byte{1}), Y: b64([]byte{2})}
+
+	if _, err := PublicKey(jwk); err == nil {
+		t.Fatal("expected an unsupported EC curve to be rejected")
+	}
+}
+
+func TestPublicKey_OKP_Ed25519(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate Ed25519 key: %v", err)
+	}
+
+	jwk := &JWK{Kty: "OKP", Crv: "Ed25519", X: b64(pub)}
+
+	key, err := PublicKey(jwk)
+	if err != nil {
+		t.Fatalf("unable to build OKP public key: %v", err)
+	}
+
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		t.Fatalf("expected ed25519.PublicKey, got %T", key)
+	}
+	if !edKey.Equal(pub) {
+		t.Fatal("parsed Ed25519 key does not match the generated key")
+	}
+}
+
+func TestPublicKey_OKP_UnsupportedCurve(t *testing.T) {
+	jwk := &JWK{Kty: "OKP", Crv: "X25519", X: b64([]byte("not-a-public-key"))}
+
+	if _, err := PublicKey(jwk); err == nil {
+		t.Fatal("expected an unsupported OKP curve to be rejected")
+	}
+}
+
+func TestPublicKey_OKP_WrongLength(t *testing.T) {
+	jwk := &JWK{Kty: "OKP", Crv: "Ed25519", X: b64([]byte{1, 2, 3})}
+
+	if _, err := PublicKey(jwk); err == nil {
+		t.Fatal("expected a truncated Ed25519 key to be rejected")
+	}
+}
+
+func TestPublicKey_UnsupportedKty(t *testing.T) {
+	jwk := &JWK{Kty: "oct"}
+
+	if _, err := PublicKey(jwk); err == nil {
+		t.Fatal("expected an unsupported kty to be rejected")
+	}
+}
+
+func TestPublicKey_MismatchedKtyAndCrv(t *testing.T) {
+	// An EC-shaped key claiming kty "OKP" should be rejected by the OKP
+	// curve check rather than silently parsed as something it isn't.
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate EC key: %v", err)
+	}
+
+	jwk := &JWK{Kty: "OKP", Crv: "P-256", X: b64(priv.X.Bytes())}
+
+	if _, err := PublicKey(jwk); err == nil {
+		t.Fatal("expected an EC curve under kty OKP to be rejected")
+	}
+}
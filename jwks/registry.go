@@ -0,0 +1,118 @@
+package jwks
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Issuer is one trusted OIDC issuer: DiscoveryURL is fetched for
+// "/.well-known/openid-configuration" and must match the token's iss
+// claim exactly (trailing slashes ignored), per the OIDC discovery spec.
+type Issuer struct {
+	Name         string `yaml:"name"`
+	DiscoveryURL string `yaml:"discovery_url"`
+}
+
+type cachedValidation struct {
+	claims jwt.MapClaims
+	exp    time.Time
+}
+
+// Registry selects among several trusted issuers' JWKS by the token's iss
+// claim, and caches successful validations (keyed by token hash) until
+// the JWT's exp so repeated proxy requests don't re-verify the same JWT.
+type Registry struct {
+	managers map[string]*Manager // keyed by Issuer.DiscoveryURL, trailing slash trimmed
+
+	validations sync.Map // sha256 hex digest -> cachedValidation
+}
+
+// NewRegistry constructs a Registry with one Manager per configured
+// issuer. Call Start to begin background refreshes before serving
+// traffic.
+func NewRegistry(issuers []Issuer, refreshInterval time.Duration) *Registry {
+	managers := make(map[string]*Manager, len(issuers))
+	for _, issuer := range issuers {
+		key := strings.TrimRight(issuer.DiscoveryURL, "/")
+		managers[key] = NewManager(issuer.DiscoveryURL, refreshInterval)
+	}
+	return &Registry{managers: managers}
+}
+
+// Start fetches every issuer's JWKS once synchronously, then refreshes
+// each in the background until ctx is cancelled.
+func (r *Registry) Start(ctx context.Context) error {
+	for discoveryURL, manager := range r.managers {
+		if err := manager.Start(ctx); err != nil {
+			return fmt.Errorf("issuer %q: %w", discoveryURL, err)
+		}
+	}
+	return nil
+}
+
+// KeyFunc returns a jwt.Keyfunc suitable for jwt.Parse that selects the
+// Manager matching the token's iss claim, then builds the appropriate
+// crypto key for the token's kid regardless of whether it's an RSA, EC,
+// or OKP (Ed25519) key.
+func (r *Registry) KeyFunc() jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodEd25519:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, fmt.Errorf("unable to read claims to determine issuer")
+		}
+		iss, _ := claims["iss"].(string)
+
+		manager, ok := r.managers[strings.TrimRight(iss, "/")]
+		if !ok {
+			return nil, fmt.Errorf("untrusted issuer: %v", iss)
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		jwk, err := manager.Key(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		return PublicKey(jwk)
+	}
+}
+
+// HashToken returns the cache key used to look up or store a validated
+// token: the hex-encoded SHA-256 digest of the raw token string.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("%x", sum)
+}
+
+// CachedClaims returns the claims from a previously validated token, if the
+// cache entry exists and hasn't reached the JWT's exp yet.
+func (r *Registry) CachedClaims(tokenHash string) (jwt.MapClaims, bool) {
+	v, ok := r.validations.Load(tokenHash)
+	if !ok {
+		return nil, false
+	}
+	entry := v.(cachedValidation)
+	if time.Now().After(entry.exp) {
+		r.validations.Delete(tokenHash)
+		return nil, false
+	}
+	return entry.claims, true
+}
+
+// CacheValidation records that tokenHash validated successfully to claims,
+// expiring the cache entry at exp (the JWT's own exp claim).
+func (r *Registry) CacheValidation(tokenHash string, claims jwt.MapClaims, exp time.Time) {
+	r.validations.Store(tokenHash, cachedValidation{claims: claims, exp: exp})
+}
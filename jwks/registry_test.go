@@ -0,0 +1,76 @@
+package jwks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestRegistry_KeyFunc_UntrustedIssuer(t *testing.T) {
+	registry := NewRegistry(nil, time.Hour)
+
+	token := &jwt.Token{
+		Method: jwt.SigningMethodRS256,
+		Header: map[string]interface{}{"kid": "some-kid"},
+		Claims: jwt.MapClaims{"iss": "https://evil.example"},
+	}
+
+	if _, err := registry.KeyFunc()(token); err == nil {
+		t.Fatal("expected an issuer outside the trusted list to be rejected")
+	}
+}
+
+func TestRegistry_KeyFunc_UnexpectedSigningMethod(t *testing.T) {
+	registry := NewRegistry(nil, time.Hour)
+
+	token := &jwt.Token{
+		Method: jwt.SigningMethodHS256,
+		Claims: jwt.MapClaims{"iss": "https://token.actions.githubusercontent.com"},
+	}
+
+	if _, err := registry.KeyFunc()(token); err == nil {
+		t.Fatal("expected an HMAC-signed token to be rejected")
+	}
+}
+
+func TestRegistry_KeyFunc_MatchesIssuerIgnoringTrailingSlash(t *testing.T) {
+	registry := NewRegistry([]Issuer{{Name: "test", DiscoveryURL: "https://issuer.example"}}, time.Hour)
+
+	token := &jwt.Token{
+		Method: jwt.SigningMethodRS256,
+		Header: map[string]interface{}{"kid": "some-kid"},
+		Claims: jwt.MapClaims{"iss": "https://issuer.example/"},
+	}
+
+	// The manager has never been Start()ed so it has no cached keys; this
+	// only exercises issuer selection, which should get past the
+	// "untrusted issuer" check and fail later while fetching the key.
+	_, err := registry.KeyFunc()(token)
+	if err == nil || err.Error() == "untrusted issuer: https://issuer.example/" {
+		t.Fatalf("expected issuer lookup to succeed (modulo the later key fetch failing), got: %v", err)
+	}
+}
+
+func TestRegistry_CachedClaims_ExpiredEntryIsAMiss(t *testing.T) {
+	registry := NewRegistry(nil, time.Hour)
+	registry.CacheValidation("hash", jwt.MapClaims{"sub": "test"}, time.Now().Add(-time.Minute))
+
+	if _, ok := registry.CachedClaims("hash"); ok {
+		t.Fatal("expected an already-expired cached validation to be treated as a miss")
+	}
+}
+
+func TestRegistry_CachedClaims_ValidEntryHits(t *testing.T) {
+	registry := NewRegistry(nil, time.Hour)
+	claims := jwt.MapClaims{"sub": "test"}
+	registry.CacheValidation("hash", claims, time.Now().Add(time.Minute))
+
+	got, ok := registry.CachedClaims("hash")
+	if !ok {
+		t.Fatal("expected a not-yet-expired cached validation to hit")
+	}
+	if got["sub"] != "test" {
+		t.Fatalf("got %v", got)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+// logger emits one structured JSON record per gateway decision, replacing
+// the ad hoc fmt.Println debug prints this gateway used to ship with.
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// decisionRecord accumulates the fields worth logging about a single
+// gateway request as they become known, and emits them as one JSON
+// record per decision (and, for proxied CONNECTs, a second record once
+// the tunnel closes with the byte count).
+type decisionRecord struct {
+	start time.Time
+
+	subject    string
+	repository string
+	workflow   string
+	runID      string
+
+	rule         string
+	upstreamHost string
+}
+
+func newDecisionRecord(claims map[string]interface{}, upstreamHost string) *decisionRecord {
+	r := &decisionRecord{start: time.Now(), upstreamHost: upstreamHost}
+	r.subject, _ = claims["sub"].(string)
+	r.repository, _ = claims["repository"].(string)
+	r.workflow, _ = claims["workflow"].(string)
+	r.runID, _ = claims["run_id"].(string)
+	return r
+}
+
+func (r *decisionRecord) args(decision, reason string) []any {
+	return []any{
+		"subject", r.subject,
+		"repository", r.repository,
+		"workflow", r.workflow,
+		"run_id", r.runID,
+		"rule", r.rule,
+		"upstream_host", r.upstreamHost,
+		"decision", decision,
+		"reason", reason,
+		"latency_ms", time.Since(r.start).Milliseconds(),
+	}
+}
+
+func (r *decisionRecord) logDenied(reason string) {
+	requestsTotal.WithLabelValues("deny", r.repository).Inc()
+	logger.Info("gateway decision", r.args("deny", reason)...)
+}
+
+func (r *decisionRecord) logAllowed(rule string) {
+	r.rule = rule
+	requestsTotal.WithLabelValues("allow", r.repository).Inc()
+	logger.Info("gateway decision", r.args("allow", "")...)
+}
+
+func (r *decisionRecord) logStreamClosed(bytesTransferred int64) {
+	logger.Info("gateway stream closed",
+		"subject", r.subject,
+		"repository", r.repository,
+		"rule", r.rule,
+		"upstream_host", r.upstreamHost,
+		"bytes_transferred", bytesTransferred,
+		"latency_ms", time.Since(r.start).Milliseconds(),
+	)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics are exposed on a separate admin listener (see serveAdmin below)
+// so operators can scrape them without exposing the gateway's
+// proxy port.
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_requests_total",
+		Help: "Number of requests handled by the gateway, by decision and repository.",
+	}, []string{"decision", "repository"})
+
+	upstreamBytesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gateway_upstream_bytes_total",
+		Help: "Total bytes proxied to and from upstream hosts over CONNECT tunnels.",
+	})
+
+	jwksRefreshTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gateway_jwks_refresh_total",
+		Help: "Number of JWKS refreshes performed across all trusted issuers.",
+	})
+
+	tokenValidationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: "gateway_token_validation_seconds",
+		Help: "Time spent validating an incoming bearer token.",
+	})
+)
+
+// serveAdmin exposes Prometheus metrics on a listener separate from the
+// proxy port, so operators can scrape it without routing OIDC-gated
+// traffic through it.
+func serveAdmin() {
+	addr := os.Getenv("GATEWAY_ADMIN_ADDR")
+	if addr == "" {
+		addr = ":9090"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	fmt.Println("serving admin metrics at " + addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error("admin listener stopped", "error", err.Error())
+	}
+}
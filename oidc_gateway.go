@@ -1,181 +1,172 @@
 package main
 
 import (
-	"crypto/rsa"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"math/big"
 	"net"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/tonit/actions-oidc-gateway/jwks"
 )
 
-type JWK struct {
-	N   string
-	Kty string
-	Kid string
-	Alg string
-	E   string
-	Use string
-	X5c []string
-	X5t string
-}
-
-type JWKS struct {
-	Keys []JWK
-}
+// jwksRefreshInterval bounds how stale the cached JWKS can be absent a
+// Cache-Control/Expires hint from the discovery response, and how often
+// the background refresh loop in jwks.Manager wakes up.
+const jwksRefreshInterval = time.Minute
 
 type GatewayContext struct {
-	jwksCache      []byte
-	jwksLastUpdate time.Time
-}
+	jwksRegistry *jwks.Registry
 
-func getKeyFromJwks(jwksBytes []byte) func(*jwt.Token) (interface{}, error) {
-	return func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
+	// opaqueValidator is nil unless an introspection_endpoint was
+	// configured; without it, non-JWT bearer tokens are simply rejected.
+	opaqueValidator *OpaqueTokenValidator
 
-		var jwks JWKS
-		if err := json.Unmarshal(jwksBytes, &jwks); err != nil {
-			return nil, fmt.Errorf("Unable to parse JWKS")
-		}
+	// preferIntrospection, when set, sends every token through
+	// opaqueValidator even if it's shaped like a JWT -- for providers that
+	// issue JWT-shaped tokens they'd rather the gateway not trust on its
+	// own signature check, or policies that want introspection mandatory.
+	preferIntrospection bool
 
-		for _, jwk := range jwks.Keys {
-			if jwk.Kid == token.Header["kid"] {
-				nBytes, err := base64.RawURLEncoding.DecodeString(jwk.N)
-				if err != nil {
-					return nil, fmt.Errorf("Unable to parse key")
-				}
-				var n big.Int
-
-				eBytes, err := base64.RawURLEncoding.DecodeString(jwk.E)
-				if err != nil {
-					return nil, fmt.Errorf("Unable to parse key")
-				}
-				var e big.Int
-
-				key := rsa.PublicKey{
-					N: n.SetBytes(nBytes),
-					E: int(e.SetBytes(eBytes).Uint64()),
-				}
-
-				return &key, nil
-			}
-		}
-
-		return nil, fmt.Errorf("Unknown kid: %v", token.Header["kid"])
-	}
+	policy *PolicyEngine
 }
 
 func validateTokenCameFromGitHub(oidcTokenString string, gc *GatewayContext) (jwt.MapClaims, error) {
-	// Check if we have a recently cached JWKS
-	now := time.Now()
+	start := time.Now()
+	defer func() { tokenValidationSeconds.Observe(time.Since(start).Seconds()) }()
 
-	if now.Sub(gc.jwksLastUpdate) > time.Minute || len(gc.jwksCache) == 0 {
-		// Get this from OICD discovery endpoint
-		jwks_url, err := discoverJwksUrl("https://token.actions.githubusercontent.com")
-		if err != nil {
-			fmt.Println(err)
-			return nil, fmt.Errorf("Unable to get OpenID configuration")
+	if !looksLikeJWT(oidcTokenString) || gc.preferIntrospection {
+		if gc.opaqueValidator == nil {
+			if gc.preferIntrospection {
+				return nil, fmt.Errorf("introspection is preferred but no introspection endpoint is configured")
+			}
+			return nil, fmt.Errorf("token is not a JWT and no introspection endpoint is configured")
 		}
-		resp, err := http.Get(jwks_url)
+		claims, err := gc.opaqueValidator.Validate(oidcTokenString)
 		if err != nil {
-			fmt.Println(err)
-			return nil, fmt.Errorf("Unable to get JWKS configuration")
-		}
-
-		jwksBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			fmt.Println(err)
-			return nil, fmt.Errorf("Unable to get JWKS configuration")
+			return nil, fmt.Errorf("unable to validate opaque token: %w", err)
 		}
+		return jwt.MapClaims(claims), nil
+	}
 
-		gc.jwksCache = jwksBytes
-		gc.jwksLastUpdate = now
+	tokenHash := jwks.HashToken(oidcTokenString)
+	if claims, ok := gc.jwksRegistry.CachedClaims(tokenHash); ok {
+		return claims, nil
 	}
 
-	// Attempt to validate JWT with JWKS
-	oidcToken, err := jwt.Parse(string(oidcTokenString), getKeyFromJwks(gc.jwksCache))
-	if err != nil || !oidcToken.Valid {
-		fmt.Println(err)
-		return nil, fmt.Errorf("Unable to validate JWT")
+	oidcToken, err := jwt.Parse(oidcTokenString, gc.jwksRegistry.KeyFunc())
+	if err != nil {
+		return nil, fmt.Errorf("unable to validate JWT: %w", err)
+	}
+	if !oidcToken.Valid {
+		return nil, fmt.Errorf("unable to validate JWT")
 	}
 
 	claims, ok := oidcToken.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil, fmt.Errorf("Unable to map JWT claims")
+		return nil, fmt.Errorf("unable to map JWT claims")
 	}
 
-	return claims, nil
-}
-
-func discoverJwksUrl(endpoint string) (string, error) {
-	resp, err := http.Get(endpoint + "/.well-known/openid-configuration")
-	if err != nil {
-		fmt.Println(err)
-		return "", fmt.Errorf("unable to get OpenID configuration")
-	}
-
-	bytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println(err)
-		return "", fmt.Errorf("unable to get OpenID configuration (parsing body)")
+	expClaim, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("unable to read JWT exp claim")
 	}
+	gc.jwksRegistry.CacheValidation(tokenHash, claims, time.Unix(int64(expClaim), 0))
 
-	var result map[string]interface{}
-
-	if json.Unmarshal(bytes, &result) != nil {
-		fmt.Println(err)
-		return "", fmt.Errorf("unable to parse OpenID configuration")
-	}
-	// get jwks_uri from json
-	return result["jwks_uri"].(string), nil
+	return claims, nil
 }
 
-func transfer(destination io.WriteCloser, source io.ReadCloser) {
+func transfer(destination io.WriteCloser, source io.ReadCloser) (int64, error) {
 	defer destination.Close()
 	defer source.Close()
-	io.Copy(destination, source)
+	buf := make([]byte, 32*1024)
+	return io.CopyBuffer(destination, source, buf)
 }
 
-func handleProxyRequest(w http.ResponseWriter, req *http.Request) {
+func handleProxyRequest(w http.ResponseWriter, req *http.Request, record *decisionRecord, upstreamPolicy *UpstreamPolicy) {
+	if err := upstreamPolicy.CheckHost(req.Host); err != nil {
+		record.logDenied(err.Error())
+		writeForbidden(w, err.Error())
+		return
+	}
+
 	proxyConn, err := net.DialTimeout("tcp", req.Host, 5*time.Second)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error("unable to dial upstream", "upstream_host", req.Host, "error", err.Error())
 		http.Error(w, http.StatusText(http.StatusRequestTimeout), http.StatusRequestTimeout)
 		return
 	}
 
+	if err := upstreamPolicy.CheckConn(proxyConn.RemoteAddr()); err != nil {
+		proxyConn.Close()
+		record.logDenied(err.Error())
+		writeForbidden(w, err.Error())
+		return
+	}
+	record.logAllowed(record.rule)
+
 	w.WriteHeader(http.StatusOK)
 
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
-		fmt.Println("Connection hijacking not supported")
+		logger.Error("connection hijacking not supported")
 		http.Error(w, http.StatusText(http.StatusExpectationFailed), http.StatusExpectationFailed)
 		return
 	}
 
 	reqConn, _, err := hijacker.Hijack()
 	if err != nil {
-		fmt.Println(err)
+		logger.Error("unable to hijack connection", "error", err.Error())
 		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
 		return
 	}
 
-	go transfer(proxyConn, reqConn)
-	go transfer(reqConn, proxyConn)
+	var upstreamBytes, downstreamBytes int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		upstreamBytes, _ = transfer(proxyConn, reqConn)
+	}()
+	go func() {
+		defer wg.Done()
+		downstreamBytes, _ = transfer(reqConn, proxyConn)
+	}()
+
+	go func() {
+		wg.Wait()
+		total := upstreamBytes + downstreamBytes
+		upstreamBytesTotal.Add(float64(total))
+		record.logStreamClosed(total)
+	}()
+}
+
+// apiExampleUpstream is the fixed upstream host /apiExample proxies to.
+// It's what policy rules must actually gate on for that path -- the
+// client's inbound Host header to the gateway itself has no relation to
+// it.
+const apiExampleUpstream = "www.bing.com"
+
+// requestUpstreamHost returns the host a policy rule should be evaluated
+// against: the CONNECT target for tunneled requests, or the fixed
+// upstream for handlers (like /apiExample) that don't let the client
+// choose a destination.
+func requestUpstreamHost(req *http.Request) string {
+	if req.Method == http.MethodConnect {
+		return req.Host
+	}
+	return apiExampleUpstream
 }
 
 func handleApiRequest(w http.ResponseWriter) {
-	resp, err := http.Get("https://www.bing.com")
+	resp, err := http.Get("https://" + apiExampleUpstream)
 	if err != nil {
-		fmt.Println(err)
+		logger.Error("upstream API request failed", "error", err.Error())
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
@@ -186,77 +177,123 @@ func handleApiRequest(w http.ResponseWriter) {
 
 func (gatewayContext *GatewayContext) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodConnect && req.RequestURI != "/apiExample" {
-		fmt.Println("Go away!")
-
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
 
-	// write all headers
-	for key, value := range req.Header {
-		fmt.Printf("Key: %s, value: %v\n", key, value)
-	}
-
 	// Check that the OIDC token verifies as a valid token from GitHub
 	//
 	// This only means the OIDC token came from any GitHub Actions workflow,
 	// we *must* check claims specific to our use case below
-	oidcTokenString := string(req.Header.Get("Gateway-Authorization"))
-	fmt.Println("OIDC token: " + oidcTokenString)
+	oidcTokenString := req.Header.Get("Gateway-Authorization")
 	claims, err := validateTokenCameFromGitHub(oidcTokenString, gatewayContext)
 	if err != nil {
-		fmt.Println(err)
+		newDecisionRecord(nil, req.Host).logDenied(err.Error())
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 		return
 	}
 
-	// Token is valid, but we *must* check some claim specific to our use case
+	// Token is valid, but we *must* check some claim specific to our use case.
 	//
 	// For examples of other claims you could check, see:
 	// https://docs.github.com/en/actions/deployment/security-hardening-your-deployments/about-security-hardening-with-openid-connect#configuring-the-oidc-trust-with-the-cloud
 	//
-	// Here we check the same claims for all requests, but you could customize
-	// the claims you check per handler below
-	// print all claims
-
-	for key, value := range claims {
-		fmt.Printf("Key: %s, value: %v\n", key, value)
-	}
-
-	allowed := "tonit/playground-workflows"
-
-	if claims["repository"] != allowed {
-		fmt.Println("repository is not " + allowed)
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-		return
-	} else {
-		fmt.Println("repository is " + allowed)
-	}
+	// Which claims are required, and what values they must take, is now
+	// driven entirely by the policy file rather than hardcoded here.
+	upstreamHost := requestUpstreamHost(req)
+	record := newDecisionRecord(claims, upstreamHost)
 
-	// You can customize the audience when you request an Actions OIDC token.
-	//
-	// This is a good idea to prevent a token being accidentally leaked by a
-	// service from being used in another service.
-	//
-	// The example in the README.md requests this specific custom audience.
-	if claims["aud"] != "api://ActionsOIDCGateway" {
-		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	rule, err := gatewayContext.policy.Evaluate(claims, upstreamHost, req.Method)
+	if err != nil {
+		record.logDenied(err.Error())
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
 		return
-
 	}
+	record.rule = rule.Name
 
 	// Now that claims have been verified, we can service the request
 	if req.Method == http.MethodConnect {
-		handleProxyRequest(w, req)
+		// The allow decision for a CONNECT is logged by handleProxyRequest
+		// once the upstream checks pass.
+		handleProxyRequest(w, req, record, NewUpstreamPolicy(rule))
 	} else if req.RequestURI == "/apiExample" {
+		record.logAllowed(rule.Name)
 		handleApiRequest(w)
 	}
 }
 
+// writeForbidden writes a structured JSON error body alongside the 403,
+// so callers can tell a disallowed CONNECT destination apart from other
+// rejection reasons without scraping a plain-text message.
+func writeForbidden(w http.ResponseWriter, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"error": reason})
+}
+
 func main() {
 	fmt.Println("Starting up...")
 
-	gatewayContext := &GatewayContext{jwksLastUpdate: time.Now()}
+	jwks.OnRefresh = func() { jwksRefreshTotal.Inc() }
+
+	policyPath := os.Getenv("GATEWAY_POLICY_FILE")
+	if policyPath == "" {
+		policyPath = "policy.yaml"
+	}
+
+	policy, err := LoadPolicyEngine(policyPath)
+	if err != nil {
+		fmt.Println("Unable to load policy file: " + err.Error())
+		return
+	}
+
+	issuersPath := os.Getenv("GATEWAY_ISSUERS_FILE")
+	if issuersPath == "" {
+		issuersPath = "issuers.yaml"
+	}
+
+	trustedIssuers, err := LoadIssuers(issuersPath)
+	if err != nil {
+		fmt.Println("Unable to load issuers file: " + err.Error())
+		return
+	}
+
+	jwksRegistry := jwks.NewRegistry(trustedIssuers, jwksRefreshInterval)
+	if err := jwksRegistry.Start(context.Background()); err != nil {
+		fmt.Println("Unable to fetch initial JWKS: " + err.Error())
+		return
+	}
+
+	go serveAdmin()
+
+	introspectionEndpoint := os.Getenv("GATEWAY_INTROSPECTION_ENDPOINT")
+	if introspectionEndpoint == "" {
+		if discoveryURL := os.Getenv("GATEWAY_INTROSPECTION_DISCOVERY_URL"); discoveryURL != "" {
+			introspectionEndpoint, err = DiscoverIntrospectionEndpoint(discoveryURL)
+			if err != nil {
+				fmt.Println("Unable to discover introspection endpoint: " + err.Error())
+				return
+			}
+		}
+	}
+
+	var opaqueValidator *OpaqueTokenValidator
+	if introspectionEndpoint != "" {
+		opaqueValidator = NewOpaqueTokenValidator(
+			introspectionEndpoint,
+			os.Getenv("GATEWAY_INTROSPECTION_CLIENT_ID"),
+			os.Getenv("GATEWAY_INTROSPECTION_CLIENT_SECRET"),
+		)
+	}
+
+	preferIntrospection := os.Getenv("GATEWAY_PREFER_INTROSPECTION") == "true"
+
+	gatewayContext := &GatewayContext{
+		jwksRegistry:        jwksRegistry,
+		opaqueValidator:     opaqueValidator,
+		preferIntrospection: preferIntrospection,
+		policy:              policy,
+	}
 
 	server := http.Server{
 		Addr:         ":8000",
@@ -266,7 +303,7 @@ func main() {
 	}
 	fmt.Println("serving at " + server.Addr)
 
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil {
 		fmt.Println("Gracefully exiting with error " + server.Addr)
 		return
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ClaimMatcher describes how a single claim on the incoming OIDC token must
+// match for a PolicyRule to apply. Kind defaults to "exact" when empty.
+//
+// Supported kinds:
+//   - "exact": the claim value must equal Value
+//   - "glob":  the claim value must match Value as a shell glob (path.Match)
+//   - "regex": the claim value must match the Value regular expression
+type ClaimMatcher struct {
+	Kind  string `yaml:"kind"`
+	Value string `yaml:"value"`
+
+	regex *regexp.Regexp
+}
+
+func (m ClaimMatcher) matches(claimValue string) bool {
+	switch m.Kind {
+	case "", "exact":
+		return claimValue == m.Value
+	case "glob":
+		ok, err := path.Match(m.Value, claimValue)
+		return err == nil && ok
+	case "regex":
+		if m.regex == nil {
+			return false
+		}
+		return m.regex.MatchString(claimValue)
+	default:
+		return false
+	}
+}
+
+// PolicyRule is a single routing rule loaded from the policy file. A rule
+// matches an incoming request when every entry in Match matches the
+// corresponding claim on the verified OIDC token, and the request's
+// destination host and HTTP method are within AllowedHosts/AllowedMethods.
+type PolicyRule struct {
+	Name string `yaml:"name"`
+
+	Match map[string]ClaimMatcher `yaml:"match"`
+
+	AllowedHosts   []string `yaml:"allowed_hosts"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+
+	// AllowedPorts restricts which destination ports a CONNECT matching
+	// this rule may target. Empty means any port is allowed.
+	AllowedPorts []int `yaml:"allowed_ports"`
+
+	// AllowPrivateNetworks permits this rule's upstreams to resolve to
+	// RFC1918/loopback/link-local addresses. Most rules should leave this
+	// false; a gateway is not supposed to be usable to reach internal
+	// infrastructure unless a rule opts in explicitly.
+	AllowPrivateNetworks bool `yaml:"allow_private_networks"`
+}
+
+func (r PolicyRule) matchesClaims(claims map[string]interface{}) bool {
+	for claim, matcher := range r.Match {
+		value, ok := claims[claim].(string)
+		if !ok || !matcher.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r PolicyRule) allowsHost(host string) bool {
+	if len(r.AllowedHosts) == 0 {
+		return false
+	}
+	// CONNECT requests carry a host:port pair; policy files list bare hosts.
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, allowed := range r.AllowedHosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+		if ok, err := path.Match(allowed, host); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r PolicyRule) allowsMethod(method string) bool {
+	if len(r.AllowedMethods) == 0 {
+		return false
+	}
+	for _, allowed := range r.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyConfig is the top-level shape of the policy file. Rules are
+// evaluated in order; the first rule whose claim matchers, allowed hosts,
+// and allowed methods all match wins.
+type PolicyConfig struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyEngine evaluates incoming requests against a PolicyConfig loaded
+// from disk at startup.
+type PolicyEngine struct {
+	rules []PolicyRule
+}
+
+// LoadPolicyEngine reads and compiles the policy file at policyPath.
+func LoadPolicyEngine(policyPath string) (*PolicyEngine, error) {
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read policy file: %w", err)
+	}
+
+	var config PolicyConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse policy file: %w", err)
+	}
+
+	for i := range config.Rules {
+		for claim, matcher := range config.Rules[i].Match {
+			if matcher.Kind != "regex" {
+				continue
+			}
+			re, err := regexp.Compile(matcher.Value)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid regex for claim %q: %w", config.Rules[i].Name, claim, err)
+			}
+			matcher.regex = re
+			config.Rules[i].Match[claim] = matcher
+		}
+	}
+
+	return &PolicyEngine{rules: config.Rules}, nil
+}
+
+// Evaluate returns the first rule whose claim matchers, destination host,
+// and HTTP method all match. If no rule matches, it returns an error
+// describing why so the caller can reject the request with 403.
+func (p *PolicyEngine) Evaluate(claims map[string]interface{}, host string, method string) (*PolicyRule, error) {
+	for i := range p.rules {
+		rule := p.rules[i]
+		if !rule.matchesClaims(claims) {
+			continue
+		}
+		if !rule.allowsMethod(method) {
+			continue
+		}
+		if !rule.allowsHost(host) {
+			continue
+		}
+		return &rule, nil
+	}
+	return nil, fmt.Errorf("no policy rule matched this request")
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClaimMatcher_ExactMatch(t *testing.T) {
+	m := ClaimMatcher{Value: "tonit/playground-workflows"}
+
+	if !m.matches("tonit/playground-workflows") {
+		t.Fatal("expected exact match to succeed")
+	}
+	if m.matches("tonit/other-repo") {
+		t.Fatal("expected exact match to fail for a different value")
+	}
+}
+
+func TestClaimMatcher_GlobMatch(t *testing.T) {
+	m := ClaimMatcher{Kind: "glob", Value: "refs/heads/*"}
+
+	if !m.matches("refs/heads/main") {
+		t.Fatal("expected glob to match refs/heads/main")
+	}
+	if m.matches("refs/tags/v1") {
+		t.Fatal("expected glob not to match refs/tags/v1")
+	}
+}
+
+func TestClaimMatcher_RegexMatch(t *testing.T) {
+	rules := mustLoadPolicyFromString(t, `
+rules:
+  - name: regex-rule
+    match:
+      ref:
+        kind: regex
+        value: ^refs/heads/(main|release/.+)$
+    allowed_hosts:
+      - example.com
+    allowed_methods:
+      - CONNECT
+`)
+
+	claims := map[string]interface{}{"ref": "refs/heads/release/1.2"}
+	if _, err := rules.Evaluate(claims, "example.com:443", "CONNECT"); err != nil {
+		t.Fatalf("expected regex rule to match: %v", err)
+	}
+
+	claims = map[string]interface{}{"ref": "refs/heads/feature/x"}
+	if _, err := rules.Evaluate(claims, "example.com:443", "CONNECT"); err == nil {
+		t.Fatal("expected regex rule not to match an unlisted branch")
+	}
+}
+
+func TestClaimMatcher_RegexNotCompiled(t *testing.T) {
+	// A regex matcher whose regex field was never compiled (e.g. built by
+	// hand rather than through LoadPolicyEngine) must fail closed, not panic.
+	m := ClaimMatcher{Kind: "regex", Value: "^main$"}
+
+	if m.matches("main") {
+		t.Fatal("expected an uncompiled regex matcher to never match")
+	}
+}
+
+func TestClaimMatcher_UnknownKind(t *testing.T) {
+	m := ClaimMatcher{Kind: "bogus", Value: "anything"}
+
+	if m.matches("anything") {
+		t.Fatal("expected an unknown matcher kind to fail closed")
+	}
+}
+
+func TestPolicyRule_MatchesClaims_MissingClaim(t *testing.T) {
+	rule := PolicyRule{Match: map[string]ClaimMatcher{"repository": {Value: "tonit/playground-workflows"}}}
+
+	if rule.matchesClaims(map[string]interface{}{}) {
+		t.Fatal("expected rule not to match when the claim is absent")
+	}
+}
+
+func TestPolicyRule_MatchesClaims_NonStringClaim(t *testing.T) {
+	rule := PolicyRule{Match: map[string]ClaimMatcher{"aud": {Value: "api://ActionsOIDCGateway"}}}
+
+	if rule.matchesClaims(map[string]interface{}{"aud": 12345}) {
+		t.Fatal("expected rule not to match when the claim isn't a string")
+	}
+}
+
+func TestPolicyRule_AllowsHost(t *testing.T) {
+	rule := PolicyRule{AllowedHosts: []string{"*.example.com"}}
+
+	if !rule.allowsHost("api.example.com:443") {
+		t.Fatal("expected glob in allowed_hosts to match a host:port pair")
+	}
+	if rule.allowsHost("api.evil.com:443") {
+		t.Fatal("expected an unlisted host to be rejected")
+	}
+}
+
+func TestPolicyRule_AllowsHost_EmptyList(t *testing.T) {
+	rule := PolicyRule{}
+
+	if rule.allowsHost("anything.example.com") {
+		t.Fatal("expected a rule with no allowed_hosts to allow nothing")
+	}
+}
+
+func TestPolicyRule_AllowsMethod_EmptyList(t *testing.T) {
+	rule := PolicyRule{}
+
+	if rule.allowsMethod("GET") {
+		t.Fatal("expected a rule with no allowed_methods to allow nothing")
+	}
+}
+
+func TestPolicyRule_AllowsMethod_CaseInsensitive(t *testing.T) {
+	rule := PolicyRule{AllowedMethods: []string{"connect"}}
+
+	if !rule.allowsMethod("CONNECT") {
+		t.Fatal("expected method matching to be case-insensitive")
+	}
+}
+
+func TestLoadPolicyEngine_RejectsInvalidRegex(t *testing.T) {
+	path := writePolicyFile(t, `
+rules:
+  - name: bad-regex
+    match:
+      ref:
+        kind: regex
+        value: "(["
+    allowed_hosts:
+      - example.com
+    allowed_methods:
+      - CONNECT
+`)
+
+	if _, err := LoadPolicyEngine(path); err == nil {
+		t.Fatal("expected an unparseable regex to be rejected at load time")
+	}
+}
+
+func TestLoadPolicyEngine_MissingFile(t *testing.T) {
+	if _, err := LoadPolicyEngine("/no/such/policy.yaml"); err == nil {
+		t.Fatal("expected a missing policy file to be an error")
+	}
+}
+
+func TestPolicyEngine_Evaluate_FirstMatchWins(t *testing.T) {
+	engine := mustLoadPolicyFromString(t, `
+rules:
+  - name: narrow
+    match:
+      repository:
+        value: tonit/playground-workflows
+    allowed_hosts:
+      - internal-api.example.com
+    allowed_methods:
+      - CONNECT
+
+  - name: broad
+    allowed_hosts:
+      - "*"
+    allowed_methods:
+      - CONNECT
+`)
+
+	claims := map[string]interface{}{"repository": "tonit/playground-workflows"}
+	rule, err := engine.Evaluate(claims, "internal-api.example.com:443", "CONNECT")
+	if err != nil {
+		t.Fatalf("expected a rule to match: %v", err)
+	}
+	if rule.Name != "narrow" {
+		t.Fatalf("expected the first matching rule to win, got %q", rule.Name)
+	}
+}
+
+func TestPolicyEngine_Evaluate_NoRuleMatches(t *testing.T) {
+	engine := mustLoadPolicyFromString(t, `
+rules:
+  - name: only-rule
+    match:
+      repository:
+        value: tonit/playground-workflows
+    allowed_hosts:
+      - internal-api.example.com
+    allowed_methods:
+      - CONNECT
+`)
+
+	claims := map[string]interface{}{"repository": "tonit/some-other-repo"}
+	if _, err := engine.Evaluate(claims, "internal-api.example.com:443", "CONNECT"); err == nil {
+		t.Fatal("expected no rule to match an unrelated repository claim")
+	}
+}
+
+func TestPolicyEngine_Evaluate_WrongMethodDoesNotMatch(t *testing.T) {
+	engine := mustLoadPolicyFromString(t, `
+rules:
+  - name: connect-only
+    allowed_hosts:
+      - internal-api.example.com
+    allowed_methods:
+      - CONNECT
+`)
+
+	if _, err := engine.Evaluate(map[string]interface{}{}, "internal-api.example.com:443", "GET"); err == nil {
+		t.Fatal("expected a CONNECT-only rule not to match a GET request")
+	}
+}
+
+func writePolicyFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("unable to write policy file: %v", err)
+	}
+	return path
+}
+
+func mustLoadPolicyFromString(t *testing.T, contents string) *PolicyEngine {
+	t.Helper()
+	engine, err := LoadPolicyEngine(writePolicyFile(t, contents))
+	if err != nil {
+		t.Fatalf("unable to load policy: %v", err)
+	}
+	return engine
+}
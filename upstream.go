@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// UpstreamPolicy enforces the matched PolicyRule's upstream scope -
+// allowed ports and whether private networks are reachable - against an
+// actual CONNECT destination. The rule's AllowedHosts are already checked
+// by PolicyRule.allowsHost as part of policy evaluation; UpstreamPolicy
+// exists because a hostname allowed by the rule can still resolve (now,
+// or a moment later via DNS rebinding) to an internal address, so every
+// resolved IP, and the address Dial actually connects to, must be
+// checked too.
+type UpstreamPolicy struct {
+	rule *PolicyRule
+}
+
+// NewUpstreamPolicy builds an UpstreamPolicy scoped to rule, the
+// PolicyRule that matched the current request.
+func NewUpstreamPolicy(rule *PolicyRule) *UpstreamPolicy {
+	return &UpstreamPolicy{rule: rule}
+}
+
+// CheckHost validates a CONNECT "host:port" target before it's dialed: the
+// port against AllowedPorts, and every address the hostname currently
+// resolves to (or the literal address itself, for IPv4/IPv6 literals)
+// against the private-network rule.
+func (p *UpstreamPolicy) CheckHost(hostport string) error {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return fmt.Errorf("invalid upstream host:port %q: %w", hostport, err)
+	}
+
+	if err := p.checkPort(portStr); err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return p.checkAddr(ip)
+	}
+
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return fmt.Errorf("unable to resolve upstream host %q: %w", host, err)
+	}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		if err := p.checkAddr(ip); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckConn re-validates the address Dial actually connected to. DNS can
+// answer differently between CheckHost's lookup and the Dial a moment
+// later (DNS rebinding); this closes that window by checking the
+// connection's real remote address rather than trusting the earlier
+// resolution.
+func (p *UpstreamPolicy) CheckConn(remoteAddr net.Addr) error {
+	host, _, err := net.SplitHostPort(remoteAddr.String())
+	if err != nil {
+		return fmt.Errorf("unable to parse remote address %q: %w", remoteAddr.String(), err)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("unable to parse resolved address %q", host)
+	}
+
+	return p.checkAddr(ip)
+}
+
+func (p *UpstreamPolicy) checkPort(portStr string) error {
+	if len(p.rule.AllowedPorts) == 0 {
+		return nil
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid upstream port %q: %w", portStr, err)
+	}
+
+	for _, allowed := range p.rule.AllowedPorts {
+		if allowed == port {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("port %d is not in rule %q's allowed port list", port, p.rule.Name)
+}
+
+func (p *UpstreamPolicy) checkAddr(ip net.IP) error {
+	if p.rule.AllowPrivateNetworks {
+		return nil
+	}
+	if isPrivateOrLocal(ip) {
+		return fmt.Errorf("destination %s is a private, loopback, or link-local address", ip)
+	}
+	return nil
+}
+
+// isPrivateOrLocal reports whether ip is within RFC1918/RFC4193 private
+// space, loopback, link-local unicast/multicast, or unspecified - in
+// other words, not something a CONNECT target can legitimately want
+// unless the rule opts in via AllowPrivateNetworks. Handles both IPv4
+// and IPv6, including IPv4-mapped IPv6 literals.
+func isPrivateOrLocal(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified()
+}
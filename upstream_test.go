@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return "tcp" }
+func (a fakeAddr) String() string  { return string(a) }
+
+func TestUpstreamPolicy_CheckHost_BlocksIPv4Literal(t *testing.T) {
+	rule := &PolicyRule{Name: "test", AllowedHosts: []string{"10.0.0.5"}}
+	policy := NewUpstreamPolicy(rule)
+
+	if err := policy.CheckHost("10.0.0.5:443"); err == nil {
+		t.Fatal("expected RFC1918 literal to be blocked by default")
+	}
+}
+
+func TestUpstreamPolicy_CheckHost_AllowsIPv4LiteralWhenPermitted(t *testing.T) {
+	rule := &PolicyRule{Name: "test", AllowedHosts: []string{"10.0.0.5"}, AllowPrivateNetworks: true}
+	policy := NewUpstreamPolicy(rule)
+
+	if err := policy.CheckHost("10.0.0.5:443"); err != nil {
+		t.Fatalf("expected private literal to be allowed when AllowPrivateNetworks is set: %v", err)
+	}
+}
+
+func TestUpstreamPolicy_CheckHost_BlocksIPv6Loopback(t *testing.T) {
+	rule := &PolicyRule{Name: "test"}
+	policy := NewUpstreamPolicy(rule)
+
+	if err := policy.CheckHost("[::1]:443"); err == nil {
+		t.Fatal("expected IPv6 loopback literal to be blocked")
+	}
+}
+
+func TestUpstreamPolicy_CheckHost_BlocksIPv6LinkLocal(t *testing.T) {
+	rule := &PolicyRule{Name: "test"}
+	policy := NewUpstreamPolicy(rule)
+
+	if err := policy.CheckHost("[fe80::1]:443"); err == nil {
+		t.Fatal("expected IPv6 link-local literal to be blocked")
+	}
+}
+
+func TestUpstreamPolicy_CheckHost_AllowsPublicIPv6Literal(t *testing.T) {
+	rule := &PolicyRule{Name: "test"}
+	policy := NewUpstreamPolicy(rule)
+
+	// 2001:4860:4860::8888 is a public (Google DNS) address.
+	if err := policy.CheckHost("[2001:4860:4860::8888]:443"); err != nil {
+		t.Fatalf("expected public IPv6 literal to be allowed: %v", err)
+	}
+}
+
+func TestUpstreamPolicy_CheckHost_EnforcesAllowedPorts(t *testing.T) {
+	rule := &PolicyRule{Name: "test", AllowedPorts: []int{443}}
+	policy := NewUpstreamPolicy(rule)
+
+	if err := policy.CheckHost("8.8.8.8:8080"); err == nil {
+		t.Fatal("expected port not in AllowedPorts to be rejected")
+	}
+	if err := policy.CheckHost("8.8.8.8:443"); err != nil {
+		t.Fatalf("expected port in AllowedPorts to be allowed: %v", err)
+	}
+}
+
+// TestUpstreamPolicy_CheckConn_CatchesDNSRebinding simulates the scenario
+// CheckHost alone can't protect against: a hostname that resolved to a
+// public address during policy evaluation, but whose TCP connection
+// actually lands on a private address because the DNS answer changed
+// between the lookup and the dial.
+func TestUpstreamPolicy_CheckConn_CatchesDNSRebinding(t *testing.T) {
+	rule := &PolicyRule{Name: "test", AllowedHosts: []string{"attacker.example"}}
+	policy := NewUpstreamPolicy(rule)
+
+	rebindAddr := &net.TCPAddr{IP: net.ParseIP("169.254.169.254"), Port: 443}
+	if err := policy.CheckConn(rebindAddr); err == nil {
+		t.Fatal("expected CheckConn to block a connection that rebound to a link-local address")
+	}
+}
+
+func TestUpstreamPolicy_CheckConn_AllowsPublicAddr(t *testing.T) {
+	rule := &PolicyRule{Name: "test"}
+	policy := NewUpstreamPolicy(rule)
+
+	addr := fakeAddr("8.8.8.8:443")
+	if err := policy.CheckConn(addr); err != nil {
+		t.Fatalf("expected public address to be allowed: %v", err)
+	}
+}